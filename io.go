@@ -0,0 +1,65 @@
+package rate_limit
+
+/*
+	Copyright [2022] [wangfuyao]
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+import "io"
+
+// rateLimitedReader 对 io.Reader 的包装，每读取一个字节消耗一个令牌
+type rateLimitedReader struct {
+	r io.Reader
+	b *TokenBucket
+}
+
+// NewReader 返回一个被 b 限速的 io.Reader，每次 Read 实际读取到的字节数都会从 b 中扣除相应的令牌
+// 如果读取的字节数超过了桶的容量，会按照 TakeMax 的方式拆分成多次获取，避免 prohibitOverflow 选项下请求失败
+func NewReader(r io.Reader, b *TokenBucket) io.Reader {
+	return &rateLimitedReader{r: r, b: b}
+}
+
+func (r *rateLimitedReader) Read(buf []byte) (n int, err error) {
+	n, err = r.r.Read(buf)
+	if n <= 0 {
+		return
+	}
+	if takeErr := r.b.TakeMax(int64(n)); takeErr != nil {
+		return n, takeErr
+	}
+	return
+}
+
+// rateLimitedWriter 对 io.Writer 的包装，每写入一个字节消耗一个令牌
+type rateLimitedWriter struct {
+	w io.Writer
+	b *TokenBucket
+}
+
+// NewWriter 返回一个被 b 限速的 io.Writer，每次 Write 之前都会先阻塞获取 len(buf) 个令牌再真正写入底层 Writer，
+// 保证限速在字节真正写出之前生效；如果写入的字节数超过了桶的容量，会按照 TakeMax 的方式拆分成多次获取，
+// 避免 prohibitOverflow 选项下请求失败。如果底层 Writer 发生短写，多预扣的那部分令牌会被退还
+func NewWriter(w io.Writer, b *TokenBucket) io.Writer {
+	return &rateLimitedWriter{w: w, b: b}
+}
+
+func (w *rateLimitedWriter) Write(buf []byte) (n int, err error) {
+	if err = w.b.TakeMax(int64(len(buf))); err != nil {
+		return 0, err
+	}
+	n, err = w.w.Write(buf)
+	if n < len(buf) {
+		w.b.refund(int64(len(buf) - n))
+	}
+	return
+}
@@ -0,0 +1,104 @@
+package rate_limit
+
+/*
+	Copyright [2022] [wangfuyao]
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// KeyedLimiter 为多个 key（例如不同的客户端 IP）各自维护一个 TokenBucket，
+// 并通过 LRU 淘汰策略限制同时存在的 key 数量，避免无限增长占满内存
+type KeyedLimiter struct {
+	maxKeys      int
+	capacity     int64
+	quantum      int64
+	fillInterval time.Duration
+	opts         []OptionF
+
+	mu    sync.Mutex
+	ll    *list.List               // 最近使用在前，最久未使用在后
+	elems map[string]*list.Element // key -> 对应的 list.Element，element.Value 是 *keyedEntry
+}
+
+type keyedEntry struct {
+	key    string
+	bucket *TokenBucket
+}
+
+// NewKeyedLimiter 创建一个多租户限流器，maxKeys 为同时保留的 key 数量上限，超出后淘汰最久未使用的 key
+// capacity、quantum、fillInterval、opts 和 NewBucket 的参数含义一致，会被用来懒创建每个 key 对应的 TokenBucket
+func NewKeyedLimiter(maxKeys int, capacity, quantum int64, fillInterval time.Duration, opts ...OptionF) *KeyedLimiter {
+	if maxKeys <= 0 {
+		panic("maxKeys is not > 0")
+	}
+	return &KeyedLimiter{
+		maxKeys:      maxKeys,
+		capacity:     capacity,
+		quantum:      quantum,
+		fillInterval: fillInterval,
+		opts:         opts,
+		ll:           list.New(),
+		elems:        make(map[string]*list.Element),
+	}
+}
+
+// getOrCreate 返回 key 对应的 TokenBucket，如果不存在则懒创建，并将 key 提升为最近使用
+// 如果创建新 key 导致数量超过 maxKeys，则淘汰最久未使用的 key
+func (k *KeyedLimiter) getOrCreate(key string) *TokenBucket {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if elem, ok := k.elems[key]; ok {
+		k.ll.MoveToFront(elem)
+		return elem.Value.(*keyedEntry).bucket
+	}
+
+	bucket := NewBucket(k.capacity, k.quantum, k.fillInterval, k.opts...)
+	elem := k.ll.PushFront(&keyedEntry{key: key, bucket: bucket})
+	k.elems[key] = elem
+
+	if k.ll.Len() > k.maxKeys {
+		oldest := k.ll.Back()
+		if oldest != nil {
+			k.ll.Remove(oldest)
+			delete(k.elems, oldest.Value.(*keyedEntry).key)
+		}
+	}
+
+	return bucket
+}
+
+// Take 获取 key 对应桶中一定数量的令牌，如果令牌不够则阻塞直到获取成功
+func (k *KeyedLimiter) Take(key string, count int64) error {
+	return k.getOrCreate(key).Take(count)
+}
+
+// TryTake 尝试获取 key 对应桶中一定数量的令牌，规则和 TokenBucket.TryTake 一致
+func (k *KeyedLimiter) TryTake(key string, count int64, maxWait time.Duration) bool {
+	return k.getOrCreate(key).TryTake(count, maxWait)
+}
+
+// Available 返回 key 对应桶当前可用的令牌数量
+func (k *KeyedLimiter) Available(key string) int64 {
+	return k.getOrCreate(key).Available()
+}
+
+// Bucket 返回 key 对应的底层 *TokenBucket，供需要直接操作桶（例如 TakeAvailable、PeekWait）的调用方使用
+func (k *KeyedLimiter) Bucket(key string) *TokenBucket {
+	return k.getOrCreate(key)
+}
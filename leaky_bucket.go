@@ -0,0 +1,172 @@
+package rate_limit
+
+/*
+	Copyright [2022] [wangfuyao]
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LeakyBucket 漏桶算法的实现，和 TokenBucket 允许突发到容量不同，LeakyBucket 会把请求平滑成恒定的速率，
+// 只有在空闲之后才允许一次由 maxSlack 限定上限的小突发
+// 思路来自 go.uber.org/ratelimit：`last` 记录的是"最近一次请求被安排到的时间点"，下一次请求最早在 last+perRequest 放行；
+// last 可能在 now 之前（说明有空闲/欠账），
+// 也可能在 now 之后（说明排队排到了未来）。每次请求都按照 perRequest 的节奏推进 last
+type LeakyBucket struct {
+	perRequest time.Duration // 两次请求之间应该间隔的时间，等于 time.Second / rps
+	maxSlack   time.Duration // 允许的最大欠账（负值），避免长时间空闲后出现不受控的突发
+	*Options
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// defaultSlackRequests 默认允许积攒的空闲额度，单位是请求数，和 uber-go/ratelimit 的默认值保持一致
+const defaultSlackRequests = 10
+
+// NewLeakyBucket 创建一个漏桶限流器，rps 为每秒允许通过的请求数
+func NewLeakyBucket(rps int, opts ...OptionF) *LeakyBucket {
+	if rps <= 0 {
+		panic("rps is not > 0")
+	}
+	opt := loadOptions(opts...)
+	perRequest := time.Second / time.Duration(rps)
+	return &LeakyBucket{
+		Options:    opt,
+		perRequest: perRequest,
+		maxSlack:   -defaultSlackRequests * perRequest,
+	}
+}
+
+// WithMaxSlack 允许通过选项自定义最大欠账时间，取代默认的 -10*perRequest
+// 这里复用 LeakyBucket 自身的方法而不是 OptionF，因为 maxSlack 依赖于构造时才能确定的 perRequest
+func (l *LeakyBucket) WithMaxSlack(maxSlack time.Duration) *LeakyBucket {
+	l.maxSlack = -maxSlack
+	return l
+}
+
+// step 根据 last 和 now 计算让一个请求通过需要等待的时间，以及等待结束后新的 last
+// 这是一个纯函数，不读写 LeakyBucket 的状态，方便 takeOne 和只读的 peek 场景共用同一套推导逻辑
+func (l *LeakyBucket) step(last, now time.Time) (waitTime time.Duration, newLast time.Time) {
+	if last.IsZero() {
+		return 0, now
+	}
+	sleepFor := l.perRequest - now.Sub(last)
+	if sleepFor < l.maxSlack {
+		sleepFor = l.maxSlack
+	}
+	if sleepFor > 0 {
+		return sleepFor, now.Add(sleepFor)
+	}
+	// sleepFor <= 0 意味着我们落后于理想节奏（空闲攒下了欠账），把这部分欠账（负数）结转到 newLast 里，
+	// 这样之后的几次请求可以陆续用掉这笔"银行存款"，形成一次有上限（由 maxSlack 决定）的突发，而不是直接清零
+	return 0, now.Add(sleepFor)
+}
+
+// takeOne 让出一个请求的配额，必要时阻塞到满足恒定速率为止，返回本次实际等待的时间
+func (l *LeakyBucket) takeOne() (waitTime time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	waitTime, l.last = l.step(l.last, l.clock.Now())
+	return
+}
+
+// Take 依次让 count 个请求获得恒定速率的配额，令请求之间保持 perRequest 的间隔
+func (l *LeakyBucket) Take(count int64) error {
+	for i := int64(0); i < count; i++ {
+		l.clock.Sleep(l.takeOne())
+	}
+	return nil
+}
+
+// TakeAvailable 不会阻塞：如果下一个请求当前不需要等待，则立即返回 count，并一次性预定 count 个请求的时间片，
+// 之后的请求要等这些时间片过去才能放行；否则不消耗任何配额，返回 0
+func (l *LeakyBucket) TakeAvailable(count int64) (realCount int64) {
+	if count <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	wait, newLast := l.step(l.last, l.clock.Now())
+	if wait > 0 {
+		return 0
+	}
+	l.last = newLast.Add(l.perRequest * time.Duration(count-1))
+	return count
+}
+
+// TryTake 如果让 count 个请求通过所需要等待的时间不超过 maxWait 则阻塞到对应时间并返回 true，否则不等待直接返回 false
+func (l *LeakyBucket) TryTake(count int64, maxWait time.Duration) (succ bool) {
+	l.mu.Lock()
+	wait := l.peekWait(count)
+	l.mu.Unlock()
+	if wait > maxWait {
+		return false
+	}
+	return l.Take(count) == nil
+}
+
+// peekWait 在不修改状态的前提下，估算让 count 个请求通过所需要的总等待时间
+func (l *LeakyBucket) peekWait(count int64) time.Duration {
+	wait, _ := l.step(l.last, l.clock.Now())
+	return wait + l.perRequest*time.Duration(count-1)
+}
+
+// Available 返回下一个请求能否立即放行：能则返回 1，否则返回 0；
+// 空闲后积攒的突发额度可能允许连续放行多个请求，但不会体现在返回值里
+func (l *LeakyBucket) Available() (available int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	wait, _ := l.step(l.last, l.clock.Now())
+	if wait > 0 {
+		return 0
+	}
+	return 1
+}
+
+// TakeCtx 和 Take 类似，但是等待期间如果 ctx 被取消则提前返回 ctx.Err()
+// 由于漏桶没有"令牌"的概念可以归还，取消时已经让出的那部分配额不会被撤销
+func (l *LeakyBucket) TakeCtx(ctx context.Context, count int64) error {
+	for i := int64(0); i < count; i++ {
+		waitTime := l.takeOne()
+		done := make(chan struct{})
+		go func() {
+			l.clock.Sleep(waitTime)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// TryTakeCtx 和 TryTake 类似，等待期间如果 ctx 被取消则提前返回 false 和 ctx.Err()
+func (l *LeakyBucket) TryTakeCtx(ctx context.Context, count int64, maxWait time.Duration) (succ bool, err error) {
+	l.mu.Lock()
+	wait := l.peekWait(count)
+	l.mu.Unlock()
+	if wait > maxWait {
+		return false, nil
+	}
+	if err = l.TakeCtx(ctx, count); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,36 @@
+package middleware
+
+/*
+	Copyright [2022] [wangfuyao]
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+import (
+	"context"
+
+	rate_limit "github.com/fuyao-w/rate_limit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor 返回一个 gRPC 一元拦截器，每次调用消耗一个令牌，令牌不足时直接拒绝并返回 ResourceExhausted
+// 这里不会阻塞等待令牌，避免一个限流中的调用占住 gRPC 的处理协程
+func UnaryServerInterceptor(rl rate_limit.RateLimit) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !rl.TryTake(1, 0) {
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+		return handler(ctx, req)
+	}
+}
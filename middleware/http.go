@@ -0,0 +1,108 @@
+package middleware
+
+/*
+	Copyright [2022] [wangfuyao]
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	rate_limit "github.com/fuyao-w/rate_limit"
+)
+
+// MiddlewareOption 用于自定义 HTTPMiddleware 的行为
+type MiddlewareOption func(o *middlewareOptions)
+
+type middlewareOptions struct {
+	cost     func(r *http.Request) int64
+	key      func(r *http.Request) string
+	keyed    *rate_limit.KeyedLimiter
+	maxWait  time.Duration
+	blocking bool
+}
+
+// WithCost 自定义每个请求消耗的令牌数，默认每个请求消耗 1 个令牌
+func WithCost(cost func(r *http.Request) int64) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.cost = cost
+	}
+}
+
+// WithKey 按照 key 提取函数把请求路由到 KeyedLimiter 中对应 key 的桶，而不是共享同一个 RateLimit
+func WithKey(keyed *rate_limit.KeyedLimiter, key func(r *http.Request) string) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.keyed = keyed
+		o.key = key
+	}
+}
+
+// WithBlocking 不直接拒绝请求，而是阻塞到 maxWait 为止，如果在 maxWait 内获取到了令牌则放行，否则才返回 429
+func WithBlocking(maxWait time.Duration) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.blocking = true
+		o.maxWait = maxWait
+	}
+}
+
+// HTTPMiddleware 返回一个标准的 http.Handler 中间件，默认策略是：令牌不足时立即返回 429，
+// 并通过 Retry-After 头告诉客户端需要等待多久；配合 WithBlocking 可以改为阻塞到 maxWait。
+// 只有 rl 是 *rate_limit.TokenBucket 或者使用了 WithKey 时才会设置 Retry-After，其他 RateLimit 实现只返回 429
+func HTTPMiddleware(rl rate_limit.RateLimit, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	o := &middlewareOptions{cost: func(*http.Request) int64 { return 1 }}
+	for _, f := range opts {
+		f(o)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cost := o.cost(r)
+			bucket, _ := rl.(*rate_limit.TokenBucket)
+			if o.keyed != nil {
+				bucket = o.keyed.Bucket(o.key(r))
+			}
+			if !allow(rl, bucket, o, cost) {
+				retryAfter(w, bucket, cost)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allow 判断本次请求是否可以放行，阻塞模式下会等待到 maxWait 为止
+// 这里必须用 TryTake 而不是 TakeAvailable：TakeAvailable 在令牌不够时会把桶里剩下的令牌全部清零再返回部分值，
+// 导致一个被拒绝的高 cost 请求顺手榨干桶，连后面本该能放行的低 cost 请求也一起饿死；
+// TryTake 在无法满足 cost 时是真正的全有或全无，不会产生这种副作用
+func allow(rl rate_limit.RateLimit, bucket *rate_limit.TokenBucket, o *middlewareOptions, cost int64) bool {
+	limiter := rl
+	if bucket != nil {
+		limiter = bucket
+	}
+	maxWait := o.maxWait
+	if !o.blocking {
+		maxWait = 0
+	}
+	return limiter.TryTake(cost, maxWait)
+}
+
+// retryAfter 拒绝请求时计算 Retry-After 并返回 429
+func retryAfter(w http.ResponseWriter, bucket *rate_limit.TokenBucket, cost int64) {
+	if bucket != nil {
+		if wait := bucket.PeekWait(cost); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+		}
+	}
+	w.WriteHeader(http.StatusTooManyRequests)
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	rate_limit "github.com/fuyao-w/rate_limit"
+)
+
+func TestHTTPMiddlewareRejectsWhenExhausted(t *testing.T) {
+	bucket := rate_limit.NewBucket(1, 1, time.Hour)
+	mw := HTTPMiddleware(bucket)
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	rec1 := httptest.NewRecorder()
+	handler.ServeHTTP(rec1, req)
+	if rec1.Code != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", rec1.Code)
+	}
+
+	rec2 := httptest.NewRecorder()
+	handler.ServeHTTP(rec2, req)
+	if rec2.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected second request to be rejected with 429, got %d", rec2.Code)
+	}
+	if rec2.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected Retry-After header to be set on rejection")
+	}
+}
+
+func TestHTTPMiddlewareWithKeyIsolatesCallers(t *testing.T) {
+	keyed := rate_limit.NewKeyedLimiter(10, 1, 1, time.Hour)
+	mw := HTTPMiddleware(nil, WithKey(keyed, func(r *http.Request) string { return r.Header.Get("X-Client") }))
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	reqA := httptest.NewRequest(http.MethodGet, "/", nil)
+	reqA.Header.Set("X-Client", "a")
+	reqB := httptest.NewRequest(http.MethodGet, "/", nil)
+	reqB.Header.Set("X-Client", "b")
+
+	recA := httptest.NewRecorder()
+	handler.ServeHTTP(recA, reqA)
+	if recA.Code != http.StatusOK {
+		t.Fatalf("expected client a's first request to pass, got %d", recA.Code)
+	}
+
+	recB := httptest.NewRecorder()
+	handler.ServeHTTP(recB, reqB)
+	if recB.Code != http.StatusOK {
+		t.Fatalf("expected client b to have its own independent bucket, got %d", recB.Code)
+	}
+}
+
+// TestHTTPMiddlewareRejectedExpensiveRequestDoesNotStarveCheapOnes makes sure a rejected
+// high-cost request leaves the bucket untouched, so a cheap request right behind it can still
+// be served instead of being starved by the partial drain TakeAvailable would have caused.
+func TestHTTPMiddlewareRejectedExpensiveRequestDoesNotStarveCheapOnes(t *testing.T) {
+	bucket := rate_limit.NewBucket(3, 1, time.Hour)
+	mw := HTTPMiddleware(bucket, WithCost(func(r *http.Request) int64 {
+		cost, _ := strconv.ParseInt(r.Header.Get("X-Cost"), 10, 64)
+		return cost
+	}))
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	expensive := httptest.NewRequest(http.MethodGet, "/", nil)
+	expensive.Header.Set("X-Cost", "5")
+	recExpensive := httptest.NewRecorder()
+	handler.ServeHTTP(recExpensive, expensive)
+	if recExpensive.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the cost=5 request against a 3-token bucket to be rejected, got %d", recExpensive.Code)
+	}
+
+	cheap := httptest.NewRequest(http.MethodGet, "/", nil)
+	cheap.Header.Set("X-Cost", "1")
+	recCheap := httptest.NewRecorder()
+	handler.ServeHTTP(recCheap, cheap)
+	if recCheap.Code != http.StatusOK {
+		t.Fatalf("expected the cost=1 request to still be served after the rejected cost=5 one, got %d", recCheap.Code)
+	}
+}
@@ -16,6 +16,7 @@ package rate_limit
    limitations under the License.
 */
 import (
+	"context"
 	"time"
 )
 
@@ -24,4 +25,6 @@ type RateLimit interface {
 	Take(count int64) error
 	TakeAvailable(count int64) (realCount int64)
 	TryTake(count int64, maxWait time.Duration) (succ bool)
+	TakeCtx(ctx context.Context, count int64) error
+	TryTakeCtx(ctx context.Context, count int64, maxWait time.Duration) (succ bool, err error)
 }
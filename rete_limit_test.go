@@ -1,6 +1,9 @@
 package rate_limit
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"sync"
 	"testing"
 	"time"
@@ -190,3 +193,270 @@ func TestTake(t *testing.T) {
 	w, succ = buc.take(100, mClock.Now(), -1*time.Second)
 	t.Log(w, succ)
 }
+
+func TestSetRate(t *testing.T) {
+	mc := new(mockClock)
+	interval := time.Second
+	b := NewBucket(10, 1, interval, WithClock(mc))
+
+	if got := b.TakeAvailable(10); got != 10 {
+		t.Fatalf("expected to drain all 10 tokens, got %d", got)
+	}
+	if avail := b.Available(); avail != 0 {
+		t.Fatalf("expected 0 available after draining, got %d", avail)
+	}
+
+	b.SetRate(5, interval)
+
+	mc.mockNow(2 * interval)
+	if avail := b.Available(); avail != 10 {
+		t.Fatalf("expected new quantum to refill to capacity, got %d", avail)
+	}
+}
+
+func TestSetCapacity(t *testing.T) {
+	mc := new(mockClock)
+	interval := time.Second
+	b := NewBucket(10, 1, interval, WithClock(mc))
+
+	b.SetCapacity(3)
+	if avail := b.Available(); avail != 3 {
+		t.Fatalf("expected SetCapacity to clamp available tokens down to 3, got %d", avail)
+	}
+
+	b.SetCapacity(20)
+	if avail := b.Available(); avail != 3 {
+		t.Fatalf("expected expanding capacity to not discard existing tokens, got %d", avail)
+	}
+}
+
+func TestRateLimitedReader(t *testing.T) {
+	mc := new(mockClock)
+	b := NewBucket(100, 1, time.Second, WithClock(mc))
+	r := NewReader(bytes.NewReader(bytes.Repeat([]byte{'a'}, 50)), b)
+
+	buf := make([]byte, 50)
+	n, err := r.Read(buf)
+	if n != 50 || err != nil {
+		t.Fatalf("unexpected read result n=%d err=%v", n, err)
+	}
+	if avail := b.Available(); avail != 50 {
+		t.Fatalf("expected 50 tokens to be charged for 50 bytes read, got %d available", avail)
+	}
+}
+
+// shortWriter always writes at most limit bytes and reports io.ErrShortWrite, mimicking an
+// underlying io.Writer that can't accept the whole buffer in one call
+type shortWriter struct {
+	limit int
+}
+
+func (s *shortWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if n > s.limit {
+		n = s.limit
+	}
+	return n, io.ErrShortWrite
+}
+
+func TestRateLimitedWriterChargesActualBytesWritten(t *testing.T) {
+	mc := new(mockClock)
+	b := NewBucket(100, 1, time.Second, WithClock(mc))
+	w := NewWriter(&shortWriter{limit: 10}, b)
+
+	n, err := w.Write(make([]byte, 50))
+	if n != 10 || err != io.ErrShortWrite {
+		t.Fatalf("unexpected write result n=%d err=%v", n, err)
+	}
+	if avail := b.Available(); avail != 90 {
+		t.Fatalf("expected only the 10 bytes actually written to be charged, got %d available", avail)
+	}
+}
+
+// orderTrackingWriter records how many tokens were available at the moment the underlying Write
+// was invoked, so the test can assert tokens are taken before the bytes hit the wire, not after
+type orderTrackingWriter struct {
+	b                *TokenBucket
+	availableAtWrite int64
+}
+
+func (o *orderTrackingWriter) Write(p []byte) (int, error) {
+	o.availableAtWrite = o.b.Available()
+	return len(p), nil
+}
+
+func TestRateLimitedWriterTakesTokensBeforeWriting(t *testing.T) {
+	mc := new(mockClock)
+	b := NewBucket(100, 1, time.Hour, WithClock(mc))
+	ow := &orderTrackingWriter{b: b}
+	w := NewWriter(ow, b)
+
+	if _, err := w.Write(make([]byte, 10)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ow.availableAtWrite != 90 {
+		t.Fatalf("expected tokens to be taken before the underlying Write runs, got %d available at write time", ow.availableAtWrite)
+	}
+}
+
+// TestTakeCtxGoesThroughMockClock makes sure TakeCtx waits via the injected Clock instead of a
+// raw time.After: with mockClock.Sleep being a no-op, a wait that would otherwise be a full hour
+// of wall-clock time must return virtually instantly.
+func TestTakeCtxGoesThroughMockClock(t *testing.T) {
+	mc := new(mockClock)
+	b := NewBucket(1, 1, time.Hour, WithClock(mc))
+	if got := b.TakeAvailable(1); got != 1 {
+		t.Fatalf("expected to drain the single token, got %d", got)
+	}
+
+	start := time.Now()
+	if err := b.TakeCtx(context.Background(), 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("TakeCtx should have waited via the mock clock's no-op Sleep, took %s", elapsed)
+	}
+}
+
+// blockingClock never resolves Sleep for any positive duration (non-positive ones return at once), so cancellation can
+// be exercised deterministically without depending on real wall-clock timing
+type blockingClock struct {
+	now time.Time
+}
+
+func (c *blockingClock) Now() time.Time { return c.now }
+func (c *blockingClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	select {}
+}
+
+func TestTakeCtxCancellationRefundsTokens(t *testing.T) {
+	bc := &blockingClock{now: time.Now()}
+	b := NewBucket(1, 1, time.Hour, WithClock(bc))
+	if got := b.TakeAvailable(1); got != 1 {
+		t.Fatalf("expected to drain the single token, got %d", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := b.TakeCtx(ctx, 1); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if avail := b.Available(); avail != 0 {
+		t.Fatalf("expected the pending take to be refunded back to 0, got %d", avail)
+	}
+}
+
+func TestKeyedLimiterIsolatesKeys(t *testing.T) {
+	kl := NewKeyedLimiter(2, 1, 1, time.Hour, WithClock(new(mockClock)))
+
+	if err := kl.Take("a", 1); err != nil {
+		t.Fatalf("unexpected error taking from key a: %v", err)
+	}
+	if avail := kl.Available("a"); avail != 0 {
+		t.Fatalf("expected key a to be drained, got %d", avail)
+	}
+	if avail := kl.Available("b"); avail != 1 {
+		t.Fatalf("expected key b to have its own untouched bucket, got %d", avail)
+	}
+}
+
+func TestKeyedLimiterEvictsLeastRecentlyUsed(t *testing.T) {
+	kl := NewKeyedLimiter(2, 1, 1, time.Hour, WithClock(new(mockClock)))
+
+	kl.Take("a", 1) // a: 0 available
+	kl.Take("b", 1) // b: 0 available, a is now least recently used
+	kl.Take("c", 1) // exceeds maxKeys=2, evicts a's bucket
+
+	if avail := kl.Available("a"); avail != 1 {
+		t.Fatalf("expected evicted key a to come back with a fresh bucket, got %d", avail)
+	}
+}
+
+func TestLeakyBucketTakeAvailableGatesOnRate(t *testing.T) {
+	mc := new(mockClock)
+	mc.initTime()
+	lb := NewLeakyBucket(1, WithClock(mc)) // 1 rps, perRequest = 1s
+
+	if got := lb.TakeAvailable(1); got != 1 {
+		t.Fatalf("expected the first request to be available immediately, got %d", got)
+	}
+	// Calling TakeAvailable again right away, with no elapsed time, must now be gated by the
+	// 1 rps pace instead of succeeding unconditionally.
+	for i := 0; i < 1000; i++ {
+		if got := lb.TakeAvailable(1); got != 0 {
+			t.Fatalf("expected pacing to gate back-to-back TakeAvailable calls, got %d on iteration %d", got, i)
+		}
+	}
+
+	mc.mockNow(time.Second)
+	if got := lb.TakeAvailable(1); got != 1 {
+		t.Fatalf("expected a request to become available again after perRequest elapses, got %d", got)
+	}
+}
+
+func TestLeakyBucketAvailableIsBinary(t *testing.T) {
+	mc := new(mockClock)
+	mc.initTime()
+	lb := NewLeakyBucket(1, WithClock(mc))
+
+	if avail := lb.Available(); avail != 1 {
+		t.Fatalf("expected 1 available before any request, got %d", avail)
+	}
+	lb.TakeAvailable(1)
+	if avail := lb.Available(); avail != 0 {
+		t.Fatalf("expected 0 available immediately after taking the paced slot, got %d", avail)
+	}
+}
+
+func TestLeakyBucketAllowsBoundedBurstAfterIdle(t *testing.T) {
+	mc := new(mockClock)
+	mc.initTime()
+	lb := NewLeakyBucket(10, WithClock(mc)) // perRequest = 100ms, default maxSlack = -10*perRequest
+
+	if got := lb.TakeAvailable(1); got != 1 {
+		t.Fatalf("expected the first request to be available immediately, got %d", got)
+	}
+
+	mc.mockNow(time.Hour) // go idle long enough to bank the maximum allowed slack
+
+	// The clamp keeps the banked debt at >= maxSlack, and the boundary itself (sleepFor == 0)
+	// still lets a request through without waiting (sleepFor <= 0), so the bounded burst is
+	// |maxSlack|/perRequest + 1, not |maxSlack|/perRequest.
+	wantBurst := defaultSlackRequests + 1
+	burst := 0
+	for i := 0; i < wantBurst+5; i++ {
+		if got := lb.TakeAvailable(1); got != 1 {
+			break
+		}
+		burst++
+	}
+	if burst != wantBurst {
+		t.Fatalf("expected a bounded burst of %d requests after a long idle period, got %d", wantBurst, burst)
+	}
+	if got := lb.TakeAvailable(1); got != 0 {
+		t.Fatalf("expected the burst allowance to be exhausted, got %d", got)
+	}
+}
+
+func TestTryTakeCtxCancellationRefundsTokens(t *testing.T) {
+	bc := &blockingClock{now: time.Now()}
+	b := NewBucket(1, 1, time.Hour, WithClock(bc))
+	if got := b.TakeAvailable(1); got != 1 {
+		t.Fatalf("expected to drain the single token, got %d", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	succ, err := b.TryTakeCtx(ctx, 1, time.Hour)
+	if succ || err != context.Canceled {
+		t.Fatalf("expected (false, context.Canceled), got (%v, %v)", succ, err)
+	}
+	if avail := b.Available(); avail != 0 {
+		t.Fatalf("expected the pending take to be refunded back to 0, got %d", avail)
+	}
+}
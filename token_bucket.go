@@ -16,6 +16,7 @@ package rate_limit
    limitations under the License.
 */
 import (
+	"context"
 	"errors"
 	"math"
 	"sync"
@@ -131,6 +132,32 @@ func (b *TokenBucket) Take(count int64) (err error) {
 	return
 }
 
+// TakeMax 获取一定数量的令牌，如果 count 超过了桶的容量，则拆分成多次不超过容量的 Take 调用，
+// 避免在开启 prohibitOverflow 选项时，单次超过容量的请求永远无法成功
+func (b *TokenBucket) TakeMax(count int64) (err error) {
+	for count > 0 {
+		capacity := b.Capacity()
+		chunk := count
+		if chunk > capacity {
+			chunk = capacity
+		}
+		if err = b.Take(chunk); err != nil {
+			return err
+		}
+		count -= chunk
+	}
+	return nil
+}
+
+// Capacity 返回桶当前的容量
+func (b *TokenBucket) Capacity() (capacity int64) {
+	b.doWithLock(func() time.Duration {
+		capacity = b.capacity
+		return 0
+	})
+	return
+}
+
 // TakeAvailable 尝试获取 count 个令牌，如果桶中令牌不够也不会阻塞，返回值告诉调用方实际上获取了多少个令牌
 // realCount 不会大于容量
 func (b *TokenBucket) TakeAvailable(count int64) (realCount int64) {
@@ -170,6 +197,85 @@ func (b *TokenBucket) TryTake(count int64, maxWait time.Duration) (succ bool) {
 	return
 }
 
+// TakeCtx 获取一定数量的令牌，如果当前桶中令牌数量不够则等待，期间如果 ctx 被取消则提前返回
+// ctx.Err()，并把已经预扣的令牌还给桶，不会产生多余的令牌
+func (b *TokenBucket) TakeCtx(ctx context.Context, count int64) (err error) {
+	var waitTime time.Duration
+	var succ bool
+	b.mu.Lock()
+	waitTime, succ = b.take(count, b.now(), infinityDuration)
+	b.mu.Unlock()
+	if !succ {
+		return ErrOverflow
+	}
+	if waitTime <= 0 {
+		return nil
+	}
+	select {
+	case <-b.sleepCh(waitTime):
+		return nil
+	case <-ctx.Done():
+		b.refund(count)
+		return ctx.Err()
+	}
+}
+
+// TryTakeCtx 和 TryTake 类似，在等待期间如果 ctx 被取消则提前返回，并把已经预扣的令牌还给桶
+func (b *TokenBucket) TryTakeCtx(ctx context.Context, count int64, maxWait time.Duration) (succ bool, err error) {
+	var waitTime time.Duration
+	b.mu.Lock()
+	waitTime, succ = b.take(count, b.now(), maxWait)
+	b.mu.Unlock()
+	if !succ {
+		return false, nil
+	}
+	if waitTime <= 0 {
+		return true, nil
+	}
+	select {
+	case <-b.sleepCh(waitTime):
+		return true, nil
+	case <-ctx.Done():
+		b.refund(count)
+		return false, ctx.Err()
+	}
+}
+
+// sleepCh 通过注入的 Clock 等待 waitTime，并把结果包装成 channel 以便和 ctx.Done() 一起 select
+// 必须经过 b.clock 而不是直接用 time.After，这样 mockClock 在测试里才能照常把等待变成同步的空操作
+func (b *TokenBucket) sleepCh(waitTime time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		b.clock.Sleep(waitTime)
+		close(done)
+	}()
+	return done
+}
+
+// refund 把之前预扣但最终没有使用的令牌还给桶，并重新结算 tick，避免产生凭空多出来的令牌
+func (b *TokenBucket) refund(count int64) {
+	b.doWithLock(func() time.Duration {
+		b.adjustAvailableTokens(b.currentTick(b.now()))
+		b.availableTokens += count
+		if b.availableTokens > b.capacity {
+			b.availableTokens = b.capacity
+		}
+		return 0
+	})
+}
+
+// PeekWait 在不消耗任何令牌的前提下，返回获取 count 个令牌当前需要等待的时间，用于提前告知调用方（例如计算 HTTP 429 的 Retry-After）
+func (b *TokenBucket) PeekWait(count int64) (waitTime time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lastTick, availableTokens := b.lastTick, b.availableTokens
+	waitTime, _ = b.take(count, b.now(), infinityDuration)
+	// take 会真正扣减 availableTokens 并推进 lastTick，这里把状态还原成调用前的样子，使 PeekWait 成为只读操作
+	b.availableTokens = availableTokens
+	b.lastTick = lastTick
+	return
+}
+
 func (b *TokenBucket) now() time.Time {
 	return b.clock.Now()
 }
@@ -193,6 +299,42 @@ func (b *TokenBucket) adjustAvailableTokens(tick int64) {
 
 }
 
+// SetRate 动态调整填充速率，调用后会先按照旧的速率结算当前令牌数，再切换到新的 quantum/fillInterval
+// 这样无需重建 TokenBucket 即可应对运行时调整限流速率的场景（例如重新加载配置文件）
+func (b *TokenBucket) SetRate(quantum int64, fillInterval time.Duration) {
+	if quantum <= 0 {
+		panic("quantum is not > 0")
+	}
+	if fillInterval <= 0 {
+		panic("fill interval is not > 0")
+	}
+	b.doWithLock(func() time.Duration {
+		now := b.now()
+		b.adjustAvailableTokens(b.currentTick(now))
+		available := b.availableTokens
+		b.quantum = quantum
+		b.fillInterval = fillInterval
+		b.createTime = now
+		b.lastTick = 0
+		b.availableTokens = available
+		return 0
+	})
+}
+
+// SetCapacity 动态调整桶容量，调小容量时会截断多余的令牌，调大容量时不会丢弃已有的令牌
+func (b *TokenBucket) SetCapacity(capacity int64) {
+	if capacity <= 0 {
+		panic("capacity is not > 0")
+	}
+	b.doWithLock(func() time.Duration {
+		b.capacity = capacity
+		if b.availableTokens > capacity {
+			b.availableTokens = capacity
+		}
+		return 0
+	})
+}
+
 // take 获取一定数量的令牌，可以选择在桶中令牌数不够情况下的最长等待时间，如果满足条件则返回实际需要等待的时间，和是否获取成功
 // count 想获取的令牌数量
 // now 当前时间